@@ -11,46 +11,161 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
 	"encoding/pem"
+	"errors"
+	"flag"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"strconv"
 	"strings"
+
+	"github.com/rscrim/rsa_keygen/pkg/rsakeys"
+	"golang.org/x/term"
 )
 
 var (
 	keyLengths = []int{2048, 3072, 4096} // Allowed key lengths in bits.
 )
 
-// encodePrivateKey encodes an RSA private key to PEM format.
-// The resulting PEM block has a "RSA PRIVATE KEY" header.
-func encodePrivateKey(privateKey *rsa.PrivateKey) ([]byte, error) {
-	block := &pem.Block{
-		Type:  "RSA PRIVATE KEY",
-		Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
+func main() {
+	bits := flag.Int("bits", 2048, "bit length for the generated key")
+	outPriv := flag.String("out-priv", "private.pem", "path to write the private key to")
+	outPub := flag.String("out-pub", "public.pem", "path to write the public key to")
+	format := flag.String("format", "pkcs1", "private key output format: pkcs1 or pkcs8 (pkcs8 when -password-file is given without -format)")
+	passwordFile := flag.String("password-file", "", "file containing the password to protect the private key (omit for no password)")
+	dkimSelector := flag.String("dkim-selector", "", "generate a DKIM key pair and DNS TXT record for this selector")
+	jsonOutput := flag.Bool("json", false, "print a JSON summary instead of human-readable output")
+	flag.Parse()
+
+	if flag.NFlag() > 0 {
+		formatSet := false
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name == "format" {
+				formatSet = true
+			}
+		})
+		if err := runNonInteractive(*bits, *outPriv, *outPub, *format, formatSet, *passwordFile, *dkimSelector, *jsonOutput); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		return
 	}
-	return pem.EncodeToMemory(block), nil
+
+	runInteractive()
 }
 
-// encodePublicKey encodes an RSA public key to PEM format.
-// The resulting PEM block has a "PUBLIC KEY" header.
-func encodePublicKey(publicKey *rsa.PublicKey) ([]byte, error) {
-	bytes, err := x509.MarshalPKIXPublicKey(publicKey)
+// runNonInteractive drives the flag-based, scriptable code path: generate a
+// keypair (and optionally a DKIM record), write it to the requested paths,
+// and report what was written.
+func runNonInteractive(bits int, outPriv, outPub, formatFlag string, formatSet bool, passwordFile, dkimSelector string, jsonOutput bool) error {
+	format, err := parseKeyFormat(formatFlag)
+	if err != nil {
+		return err
+	}
+
+	publicKey, privateKey, err := rsakeys.GenerateKeyPair(bits)
+	if err != nil {
+		return fmt.Errorf("failed to generate key pair: %w", err)
+	}
+
+	var password string
+	if passwordFile != "" {
+		data, err := os.ReadFile(passwordFile)
+		if err != nil {
+			return fmt.Errorf("failed to read password file: %w", err)
+		}
+		password = strings.TrimSpace(string(data))
+	}
+
+	var privateKeyPEM []byte
+	if password != "" {
+		// Scriptable encryption defaults to PKCS#8/PBES2 rather than the
+		// deprecated, insecure x509.EncryptPEMBlock scheme behind PKCS#1
+		// encryption; an explicit -format=pkcs1 is honored but warned about.
+		if !formatSet {
+			format = rsakeys.FormatPKCS8
+		} else if format == rsakeys.FormatPKCS1 {
+			fmt.Fprintln(os.Stderr, "Warning: -format=pkcs1 encrypts the private key with the deprecated, insecure x509.EncryptPEMBlock scheme; prefer -format=pkcs8")
+		}
+		privateKeyPEM, err = rsakeys.EncryptPrivateKey(privateKey, password, format)
+	} else {
+		privateKeyPEM, err = rsakeys.EncodePrivateKey(privateKey, format)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encode private key: %w", err)
+	}
+
+	publicKeyPEM, err := rsakeys.EncodePublicKey(publicKey)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal public key: %s", err)
+		return fmt.Errorf("failed to encode public key: %w", err)
 	}
-	block := &pem.Block{
-		Type:  "PUBLIC KEY",
-		Bytes: bytes,
+
+	if err := os.WriteFile(outPriv, privateKeyPEM, 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", outPriv, err)
+	}
+	if err := os.WriteFile(outPub, publicKeyPEM, 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", outPub, err)
+	}
+
+	var dkimTXTPath string
+	if dkimSelector != "" {
+		record, err := dkimTXTRecord(publicKey, false)
+		if err != nil {
+			return fmt.Errorf("failed to build DKIM record: %w", err)
+		}
+		dkimTXTPath = dkimSelector + ".txt"
+		txtRecord := fmt.Sprintf("%s._domainkey IN TXT %s\n", dkimSelector, record)
+		if err := os.WriteFile(dkimTXTPath, []byte(txtRecord), 0600); err != nil {
+			return fmt.Errorf("failed to write %s: %w", dkimTXTPath, err)
+		}
+	}
+
+	if jsonOutput {
+		summary := map[string]string{
+			"private_key_path": outPriv,
+			"public_key_path":  outPub,
+		}
+		if dkimTXTPath != "" {
+			summary["dkim_txt_path"] = dkimTXTPath
+		}
+		encoded, err := json.MarshalIndent(summary, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON summary: %w", err)
+		}
+		fmt.Println(string(encoded))
+		return nil
+	}
+
+	fmt.Printf("Wrote %s and %s\n", outPriv, outPub)
+	if dkimTXTPath != "" {
+		fmt.Println("Wrote", dkimTXTPath)
 	}
-	return pem.EncodeToMemory(block), nil
+	return nil
 }
 
-func main() {
+func parseKeyFormat(format string) (rsakeys.KeyFormat, error) {
+	switch format {
+	case "pkcs1":
+		return rsakeys.FormatPKCS1, nil
+	case "pkcs8":
+		return rsakeys.FormatPKCS8, nil
+	default:
+		return 0, fmt.Errorf("unknown format %q: must be pkcs1 or pkcs8", format)
+	}
+}
+
+func runInteractive() {
 	reader := bufio.NewReader(os.Stdin)
 	fmt.Println("Welcome to the custom RSA key generator!")
 	fmt.Println("-----------------------------------------")
@@ -61,6 +176,10 @@ func main() {
 		fmt.Println("-----------------")
 		fmt.Println("1. Generate new key pair")
 		fmt.Println("2. Exit")
+		fmt.Println("3. Import key and sign a JWT")
+		fmt.Println("4. Generate DKIM key")
+		fmt.Println("5. Encrypt file")
+		fmt.Println("6. Decrypt file")
 
 		// Read user input.
 		input, err := reader.ReadString('\n')
@@ -70,11 +189,44 @@ func main() {
 		}
 		input = input[:len(input)-1] // Remove newline character.
 
+		choice := strings.TrimSpace(input)
+		if choice == "2" {
+			return
+		}
+		if choice == "3" {
+			signJWTMenu(reader)
+			continue
+		}
+		if choice == "4" {
+			generateDKIMKeyMenu(reader)
+			continue
+		}
+		if choice == "5" {
+			encryptFileMenu(reader)
+			continue
+		}
+		if choice == "6" {
+			decryptFileMenu(reader)
+			continue
+		}
+
 		// Get the bit length for the key
 		bitLength := readIntInput(reader, "Enter the bit length for the key (e.g., 2048): ", 512, 4096)
 
 		// Generate the RSA key pair
-		publicKey, privateKey := generateKeyPair(bitLength)
+		publicKey, privateKey, err := rsakeys.GenerateKeyPair(bitLength)
+		if err != nil {
+			fmt.Println("Error generating RSA keys:", err)
+			continue
+		}
+
+		// Ask for the output format for the private key
+		fmt.Print("Output format for the private key, pkcs1 or pkcs8 (default pkcs1): ")
+		formatInput, _ := reader.ReadString('\n')
+		format := rsakeys.FormatPKCS1
+		if strings.EqualFold(strings.TrimSpace(formatInput), "pkcs8") {
+			format = rsakeys.FormatPKCS8
+		}
 
 		// Ask for a password to protect the private key
 		fmt.Print("Enter a password to protect your private key (leave empty for no password): ")
@@ -84,19 +236,25 @@ func main() {
 		// Convert and optionally encrypt the private key
 		var privateKeyPEM []byte
 		if password != "" {
-			privateKeyPEM = encryptPrivateKey(privateKey, password)
+			privateKeyPEM, err = rsakeys.EncryptPrivateKey(privateKey, password, format)
+			if err != nil {
+				fmt.Println("Error encrypting private key:", err)
+				continue
+			}
 		} else {
-			privateKeyPEM = pem.EncodeToMemory(&pem.Block{
-				Type:  "RSA PRIVATE KEY",
-				Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
-			})
+			privateKeyPEM, err = rsakeys.EncodePrivateKey(privateKey, format)
+			if err != nil {
+				fmt.Println("Error encoding private key:", err)
+				continue
+			}
 		}
 
 		// Convert the public key to PEM format
-		publicKeyPEM := pem.EncodeToMemory(&pem.Block{
-			Type:  "RSA PUBLIC KEY",
-			Bytes: x509.MarshalPKCS1PublicKey(publicKey),
-		})
+		publicKeyPEM, err := rsakeys.EncodePublicKey(publicKey)
+		if err != nil {
+			fmt.Println("Error encoding public key:", err)
+			continue
+		}
 
 		// Export the keys to files
 		exportKeyToFile(publicKeyPEM, "public.pem")
@@ -124,70 +282,353 @@ func readIntInput(reader *bufio.Reader, prompt string, min int, max int) int {
 	}
 }
 
-// PublicKey and PrivateKey structures
-type PublicKey struct {
-	E int64
-	N int64
+func exportKeyToFile(key []byte, filename string) {
+	err := os.WriteFile(filename, key, 0600)
+	if err != nil {
+		fmt.Println("Error exporting key:", err)
+		os.Exit(1)
+	}
+}
+
+// importPrivateKeyPrompting imports a private key from path, prompting for a
+// password on stdin if the key turns out to be encrypted.
+func importPrivateKeyPrompting(path string) (*rsa.PrivateKey, error) {
+	key, err := rsakeys.ImportKeyFromFile(path, nil)
+	if !errors.Is(err, rsakeys.ErrPasswordRequired) {
+		return key, err
+	}
+
+	fmt.Print("Enter the password for this private key: ")
+	password, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Println()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read password: %w", err)
+	}
+	return rsakeys.ImportKeyFromFile(path, password)
+}
+
+// signJWTMenu drives the "import key and sign a JWT" flow: it imports a
+// private key from a file the user names, reads the payload to sign, and
+// prints the resulting RS256-signed JWT.
+func signJWTMenu(reader *bufio.Reader) {
+	fmt.Print("Enter the path to the private key PEM file: ")
+	path, _ := reader.ReadString('\n')
+	path = strings.TrimSpace(path)
+
+	privateKey, err := importPrivateKeyPrompting(path)
+	if err != nil {
+		fmt.Println("Error importing key:", err)
+		return
+	}
+
+	fmt.Print("Enter the JSON claims to sign (e.g. {\"sub\":\"123\"}): ")
+	claimsInput, _ := reader.ReadString('\n')
+	claimsInput = strings.TrimSpace(claimsInput)
+
+	token, err := signRS256(privateKey, []byte(claimsInput))
+	if err != nil {
+		fmt.Println("Error signing JWT:", err)
+		return
+	}
+
+	fmt.Println("Signed JWT:")
+	fmt.Println(token)
+}
+
+// signRS256 builds and signs a compact RS256 JWT for the given claims JSON.
+func signRS256(privateKey *rsa.PrivateKey, claims []byte) (string, error) {
+	if !json.Valid(claims) {
+		return "", fmt.Errorf("claims must be valid JSON")
+	}
+
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal JWT header: %w", err)
+	}
+
+	signingInput := base64URLEncode(header) + "." + base64URLEncode(claims)
+
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign JWT: %w", err)
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
 }
 
-type PrivateKey struct {
-	D int64
-	N int64
+func base64URLEncode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
 }
 
-// Generate an RSA key pair of the given bit length
-func generateKeyPair(bits int) (*rsa.PublicKey, *rsa.PrivateKey) {
-	// Generate a private key
-	privateKey, err := rsa.GenerateKey(rand.Reader, bits)
+// generateDKIMKeyMenu drives the "Generate DKIM key" flow: it prompts for a
+// selector, domain and the optional legacy "t=s" flag, generates an RSA
+// keypair and writes `<selector>.private` (PEM) and `<selector>.txt` (the
+// DNS TXT record to publish at `<selector>._domainkey.<domain>`).
+func generateDKIMKeyMenu(reader *bufio.Reader) {
+	fmt.Print("Enter the selector (e.g. \"default\"): ")
+	selector, _ := reader.ReadString('\n')
+	selector = strings.TrimSpace(selector)
+
+	fmt.Print("Enter the domain (e.g. \"example.com\"): ")
+	domain, _ := reader.ReadString('\n')
+	domain = strings.TrimSpace(domain)
+
+	fmt.Print("Restrict to strict alignment with t=s? (y/N): ")
+	strictInput, _ := reader.ReadString('\n')
+	strict := strings.EqualFold(strings.TrimSpace(strictInput), "y")
+
+	bitLength := readIntInput(reader, "Enter the bit length for the key (1024 for legacy MTAs, 2048 recommended): ", 1024, 4096)
+
+	_, privateKey, err := rsakeys.GenerateKeyPair(bitLength)
 	if err != nil {
 		fmt.Println("Error generating RSA keys:", err)
-		os.Exit(1)
+		return
+	}
+
+	privateKeyPEM, err := rsakeys.EncodePrivateKey(privateKey, rsakeys.FormatPKCS1)
+	if err != nil {
+		fmt.Println("Error encoding private key:", err)
+		return
+	}
+
+	record, err := dkimTXTRecord(&privateKey.PublicKey, strict)
+	if err != nil {
+		fmt.Println("Error building DKIM record:", err)
+		return
+	}
+	txtRecord := fmt.Sprintf("%s._domainkey IN TXT %s", selector, record)
+
+	exportKeyToFile(privateKeyPEM, selector+".private")
+	exportKeyToFile([]byte(txtRecord+"\n"), selector+".txt")
+
+	fmt.Printf("DKIM key generated. Publish the record in %s.txt at %s._domainkey.%s\n", selector, selector, domain)
+}
+
+// dkimTXTRecord builds the "v=DKIM1; k=rsa; p=..." value for a DKIM DNS TXT
+// record. The public key is encoded as the raw base64 of the
+// SubjectPublicKeyInfo DER (x509.MarshalPKIXPublicKey) — not
+// asn1.Marshal(pubkey), which produces a record DNS resolvers reject. Values
+// over 255 characters are split into multiple quoted strings, since a single
+// TXT character-string is limited to 255 bytes (RFC 6376 section 3.6.1).
+func dkimTXTRecord(publicKey *rsa.PublicKey, strict bool) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal public key: %w", err)
 	}
+	encoded := base64.StdEncoding.EncodeToString(der)
 
-	// Extract the public key from the private key
-	publicKey := &privateKey.PublicKey
+	value := "v=DKIM1; k=rsa; "
+	if strict {
+		value += "t=s; "
+	}
+	value += "p=" + encoded
 
-	return publicKey, privateKey
+	return quoteDNSStrings(value), nil
 }
 
-func encryptPrivateKey(privateKey *rsa.PrivateKey, password string) []byte {
-	// Convert the private key to PEM format
-	privateKeyPEM := pem.EncodeToMemory(
-		&pem.Block{
-			Type:  "RSA PRIVATE KEY",
-			Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
-		},
-	)
+// quoteDNSStrings splits value into <=255-byte chunks and renders them as
+// one or more double-quoted DNS character-strings, e.g. `"abc" "def"`.
+func quoteDNSStrings(value string) string {
+	const maxChunk = 255
+	if len(value) <= maxChunk {
+		return `"` + value + `"`
+	}
+
+	var chunks []string
+	for len(value) > 0 {
+		n := maxChunk
+		if n > len(value) {
+			n = len(value)
+		}
+		chunks = append(chunks, `"`+value[:n]+`"`)
+		value = value[n:]
+	}
+	return strings.Join(chunks, " ")
+}
 
-	// Encrypt the PEM block with a password
-	encryptedPEM, err := x509.EncryptPEMBlock(
-		rand.Reader,
-		"RSA PRIVATE KEY",
-		privateKeyPEM,
-		[]byte(password),
-		x509.PEMCipherAES256,
-	)
+// container magic/version for files written by encryptFile. The format is:
+// magic (4 bytes) | version (1 byte) | wrapped-key length (2 bytes, BE) |
+// wrapped key | nonce (12 bytes) | AES-GCM ciphertext+tag.
+var containerMagic = [4]byte{'R', 'S', 'A', 'X'}
+
+const containerVersion = 1
+
+// importPublicKeyFromFile reads a PEM-encoded "PUBLIC KEY" (PKIX) file and
+// returns the parsed RSA public key.
+func importPublicKeyFromFile(filename string) (*rsa.PublicKey, error) {
+	raw, err := os.ReadFile(filename)
 	if err != nil {
-		fmt.Println("Error encrypting private key:", err)
-		os.Exit(1)
+		return nil, fmt.Errorf("failed to read %s: %w", filename, err)
+	}
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", filename)
+	}
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %w", err)
+	}
+	publicKey, ok := parsed.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key is not an RSA key")
+	}
+	return publicKey, nil
+}
+
+// encryptFileMenu drives the "Encrypt file" flow.
+func encryptFileMenu(reader *bufio.Reader) {
+	fmt.Print("Enter the path to the recipient's public key PEM file: ")
+	keyPath, _ := reader.ReadString('\n')
+	publicKey, err := importPublicKeyFromFile(strings.TrimSpace(keyPath))
+	if err != nil {
+		fmt.Println("Error importing public key:", err)
+		return
+	}
+
+	fmt.Print("Enter the path to the file to encrypt: ")
+	inPath, _ := reader.ReadString('\n')
+	fmt.Print("Enter the path to write the encrypted file to: ")
+	outPath, _ := reader.ReadString('\n')
+	fmt.Print("Enter an OAEP label (leave empty for none): ")
+	label, _ := reader.ReadString('\n')
+
+	plaintext, err := os.ReadFile(strings.TrimSpace(inPath))
+	if err != nil {
+		fmt.Println("Error reading input file:", err)
+		return
+	}
+
+	container, err := encryptFile(publicKey, plaintext, []byte(strings.TrimSpace(label)))
+	if err != nil {
+		fmt.Println("Error encrypting file:", err)
+		return
 	}
 
-	return pem.EncodeToMemory(encryptedPEM)
+	exportKeyToFile(container, strings.TrimSpace(outPath))
+	fmt.Println("Encrypted file written to", strings.TrimSpace(outPath))
 }
 
-func exportKeyToFile(key []byte, filename string) {
-	err := ioutil.WriteFile(filename, key, 0600)
+// decryptFileMenu drives the "Decrypt file" flow.
+func decryptFileMenu(reader *bufio.Reader) {
+	fmt.Print("Enter the path to your private key PEM file: ")
+	keyPath, _ := reader.ReadString('\n')
+	privateKey, err := importPrivateKeyPrompting(strings.TrimSpace(keyPath))
 	if err != nil {
-		fmt.Println("Error exporting key:", err)
-		os.Exit(1)
+		fmt.Println("Error importing private key:", err)
+		return
+	}
+
+	fmt.Print("Enter the path to the encrypted file: ")
+	inPath, _ := reader.ReadString('\n')
+	fmt.Print("Enter the path to write the decrypted file to: ")
+	outPath, _ := reader.ReadString('\n')
+	fmt.Print("Enter the OAEP label used to encrypt (leave empty for none): ")
+	label, _ := reader.ReadString('\n')
+
+	container, err := os.ReadFile(strings.TrimSpace(inPath))
+	if err != nil {
+		fmt.Println("Error reading encrypted file:", err)
+		return
+	}
+
+	plaintext, err := decryptFile(privateKey, container, []byte(strings.TrimSpace(label)))
+	if err != nil {
+		fmt.Println("Error decrypting file:", err)
+		return
 	}
+
+	exportKeyToFile(plaintext, strings.TrimSpace(outPath))
+	fmt.Println("Decrypted file written to", strings.TrimSpace(outPath))
 }
 
-func importKeyFromFile(filename string) []byte {
-	key, err := ioutil.ReadFile(filename)
+// encryptFile hybrid-encrypts plaintext for publicKey: a random AES-256 data
+// key encrypts plaintext with AES-GCM, and the data key itself is wrapped
+// with RSA-OAEP (SHA-256) so payloads of any size can be protected despite
+// the RSA modulus limiting how much OAEP can encrypt directly.
+func encryptFile(publicKey *rsa.PublicKey, plaintext []byte, label []byte) ([]byte, error) {
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+
+	wrappedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, publicKey, dataKey, label)
 	if err != nil {
-		fmt.Println("Error importing key:", err)
-		os.Exit(1)
+		return nil, fmt.Errorf("failed to wrap data key: %w", err)
+	}
+
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AES cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	ciphertext := gcm.Seal(nil, nonce, plaintext, nil)
+
+	var out []byte
+	out = append(out, containerMagic[:]...)
+	out = append(out, containerVersion)
+	keyLen := make([]byte, 2)
+	binary.BigEndian.PutUint16(keyLen, uint16(len(wrappedKey)))
+	out = append(out, keyLen...)
+	out = append(out, wrappedKey...)
+	out = append(out, nonce...)
+	out = append(out, ciphertext...)
+
+	return out, nil
+}
+
+// decryptFile reverses encryptFile: it unwraps the AES data key with
+// RSA-OAEP (SHA-256) using privateKey, then decrypts and authenticates the
+// payload with AES-GCM.
+func decryptFile(privateKey *rsa.PrivateKey, container []byte, label []byte) ([]byte, error) {
+	if len(container) < len(containerMagic)+1+2 {
+		return nil, fmt.Errorf("container too short")
+	}
+	if !bytes.Equal(container[:4], containerMagic[:]) {
+		return nil, fmt.Errorf("not an RSAX container")
+	}
+	if container[4] != containerVersion {
+		return nil, fmt.Errorf("unsupported container version %d", container[4])
+	}
+	rest := container[5:]
+
+	keyLen := binary.BigEndian.Uint16(rest[:2])
+	rest = rest[2:]
+	if len(rest) < int(keyLen) {
+		return nil, fmt.Errorf("container truncated in wrapped key")
+	}
+	wrappedKey := rest[:keyLen]
+	rest = rest[keyLen:]
+
+	dataKey, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, privateKey, wrappedKey, label)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AES cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+	if len(rest) < gcm.NonceSize() {
+		return nil, fmt.Errorf("container truncated in nonce")
+	}
+	nonce := rest[:gcm.NonceSize()]
+	ciphertext := rest[gcm.NonceSize():]
+
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt payload: %w", err)
 	}
-	return key
+	return plaintext, nil
 }
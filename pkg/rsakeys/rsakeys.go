@@ -0,0 +1,352 @@
+// Package rsakeys holds the key-handling logic behind the rsa_keygen CLI:
+// generating RSA keypairs, encoding/encrypting them to PEM, and importing
+// them back. Every function returns an error instead of exiting the
+// process, so it can be used from both the interactive menu and the
+// non-interactive flag-driven mode, as well as embedded in other tools.
+package rsakeys
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"os"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// KeyFormat selects the PEM encoding used for a private key.
+type KeyFormat int
+
+const (
+	// FormatPKCS1 is the legacy "RSA PRIVATE KEY" encoding.
+	FormatPKCS1 KeyFormat = iota
+	// FormatPKCS8 is the "PRIVATE KEY" / "ENCRYPTED PRIVATE KEY" encoding
+	// produced by e.g. `openssl pkcs8 -topk8`.
+	FormatPKCS8
+)
+
+// ErrPasswordRequired is returned by ImportKeyFromFile when the PEM block is
+// encrypted and no password was supplied.
+var ErrPasswordRequired = errors.New("rsakeys: private key is encrypted, a password is required")
+
+// GenerateKeyPair generates an RSA keypair of the given bit length.
+func GenerateKeyPair(bits int) (*rsa.PublicKey, *rsa.PrivateKey, error) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate RSA key: %w", err)
+	}
+	return &privateKey.PublicKey, privateKey, nil
+}
+
+// EncodePrivateKey encodes an RSA private key to PEM format in the given
+// format. FormatPKCS1 produces a "RSA PRIVATE KEY" block; FormatPKCS8
+// produces a "PRIVATE KEY" block.
+func EncodePrivateKey(privateKey *rsa.PrivateKey, format KeyFormat) ([]byte, error) {
+	if format == FormatPKCS8 {
+		der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal PKCS#8 private key: %w", err)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+	}
+	block := &pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
+	}
+	return pem.EncodeToMemory(block), nil
+}
+
+// EncodePublicKey encodes an RSA public key to PEM format.
+// The resulting PEM block has a "PUBLIC KEY" header.
+func EncodePublicKey(publicKey *rsa.PublicKey) ([]byte, error) {
+	bytes, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal public key: %w", err)
+	}
+	block := &pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: bytes,
+	}
+	return pem.EncodeToMemory(block), nil
+}
+
+// EncryptPrivateKey encodes and password-protects privateKey in the given
+// format. FormatPKCS8 produces a PKCS#8 "ENCRYPTED PRIVATE KEY" block using
+// PBES2 (PBKDF2-HMAC-SHA256 + AES-256-CBC); FormatPKCS1 falls back to the
+// legacy, deprecated x509.EncryptPEMBlock scheme for compatibility with
+// tools that still expect a classic encrypted "RSA PRIVATE KEY" block.
+func EncryptPrivateKey(privateKey *rsa.PrivateKey, password string, format KeyFormat) ([]byte, error) {
+	if format == FormatPKCS8 {
+		return encryptPKCS8PrivateKey(privateKey, password)
+	}
+
+	//lint:ignore SA1019 kept for PKCS#1 compatibility; PKCS#8 uses PBES2 below.
+	encryptedPEM, err := x509.EncryptPEMBlock( //nolint:staticcheck
+		rand.Reader,
+		"RSA PRIVATE KEY",
+		x509.MarshalPKCS1PrivateKey(privateKey),
+		[]byte(password),
+		x509.PEMCipherAES256,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt private key: %w", err)
+	}
+
+	return pem.EncodeToMemory(encryptedPEM), nil
+}
+
+// PBKDF2 iteration count for PKCS#8 encryption, in line with current OWASP
+// guidance for PBKDF2-HMAC-SHA256.
+const pbkdf2Iterations = 210000
+
+var (
+	oidPBES2          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidAES256CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type encryptedPrivateKeyInfo struct {
+	Algo          pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+// encryptPKCS8PrivateKey marshals privateKey as PKCS#8 and wraps it in a
+// PKCS#8 EncryptedPrivateKeyInfo structure (RFC 8018 PBES2), deriving the
+// AES-256 key from password with PBKDF2-HMAC-SHA256.
+func encryptPKCS8PrivateKey(privateKey *rsa.PrivateKey, password string) ([]byte, error) {
+	plaintext, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal PKCS#8 private key: %w", err)
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(iv); err != nil {
+		return nil, fmt.Errorf("failed to generate IV: %w", err)
+	}
+
+	key := pbkdf2.Key([]byte(password), salt, pbkdf2Iterations, 32, sha256.New)
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AES cipher: %w", err)
+	}
+	ciphertext := pkcs7Pad(plaintext, aes.BlockSize)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, ciphertext)
+
+	kdfParams, err := asn1.Marshal(pbkdf2Params{
+		Salt:           salt,
+		IterationCount: pbkdf2Iterations,
+		PRF:            pkix.AlgorithmIdentifier{Algorithm: oidHMACWithSHA256},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal PBKDF2 parameters: %w", err)
+	}
+	encParams, err := asn1.Marshal(iv)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal encryption scheme parameters: %w", err)
+	}
+	pbes2, err := asn1.Marshal(pbes2Params{
+		KeyDerivationFunc: pkix.AlgorithmIdentifier{Algorithm: oidPBKDF2, Parameters: asn1.RawValue{FullBytes: kdfParams}},
+		EncryptionScheme:  pkix.AlgorithmIdentifier{Algorithm: oidAES256CBC, Parameters: asn1.RawValue{FullBytes: encParams}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal PBES2 parameters: %w", err)
+	}
+
+	der, err := asn1.Marshal(encryptedPrivateKeyInfo{
+		Algo:          pkix.AlgorithmIdentifier{Algorithm: oidPBES2, Parameters: asn1.RawValue{FullBytes: pbes2}},
+		EncryptedData: ciphertext,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal EncryptedPrivateKeyInfo: %w", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: der}), nil
+}
+
+// pkcs7Pad returns data padded to a multiple of blockSize per PKCS#7.
+func pkcs7Pad(data []byte, blockSize int) []byte {
+	padLen := blockSize - len(data)%blockSize
+	padded := make([]byte, len(data)+padLen)
+	copy(padded, data)
+	for i := len(data); i < len(padded); i++ {
+		padded[i] = byte(padLen)
+	}
+	return padded
+}
+
+// pkcs7Unpad strips and validates PKCS#7 padding.
+func pkcs7Unpad(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("empty data")
+	}
+	padLen := int(data[len(data)-1])
+	if padLen == 0 || padLen > len(data) {
+		return nil, fmt.Errorf("invalid padding")
+	}
+	for _, b := range data[len(data)-padLen:] {
+		if int(b) != padLen {
+			return nil, fmt.Errorf("invalid padding")
+		}
+	}
+	return data[:len(data)-padLen], nil
+}
+
+// pbkdf2PRF returns the hash constructor for a PBKDF2 PRF AlgorithmIdentifier,
+// defaulting to HMAC-SHA1 when absent, per RFC 8018.
+func pbkdf2PRF(algo pkix.AlgorithmIdentifier) (func() hash.Hash, error) {
+	switch {
+	case len(algo.Algorithm) == 0, algo.Algorithm.Equal(oidHMACWithSHA1):
+		return sha1.New, nil
+	case algo.Algorithm.Equal(oidHMACWithSHA256):
+		return sha256.New, nil
+	default:
+		return nil, fmt.Errorf("unsupported PBKDF2 PRF %v", algo.Algorithm)
+	}
+}
+
+// decryptPKCS8PrivateKey decrypts a PKCS#8 EncryptedPrivateKeyInfo (RFC 8018
+// PBES2 with PBKDF2 and AES-256-CBC) using password, and parses the result
+// as a PKCS#8 RSA private key.
+func decryptPKCS8PrivateKey(der []byte, password []byte) (*rsa.PrivateKey, error) {
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, fmt.Errorf("failed to parse EncryptedPrivateKeyInfo: %w", err)
+	}
+	if !info.Algo.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("unsupported PKCS#8 encryption algorithm %v", info.Algo.Algorithm)
+	}
+
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.Algo.Parameters.FullBytes, &params); err != nil {
+		return nil, fmt.Errorf("failed to parse PBES2 parameters: %w", err)
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, fmt.Errorf("unsupported PKCS#8 key derivation function %v", params.KeyDerivationFunc.Algorithm)
+	}
+	if !params.EncryptionScheme.Algorithm.Equal(oidAES256CBC) {
+		return nil, fmt.Errorf("unsupported PKCS#8 encryption scheme %v", params.EncryptionScheme.Algorithm)
+	}
+
+	var kdfParams pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdfParams); err != nil {
+		return nil, fmt.Errorf("failed to parse PBKDF2 parameters: %w", err)
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, fmt.Errorf("failed to parse AES-CBC IV: %w", err)
+	}
+	if len(iv) != aes.BlockSize {
+		return nil, fmt.Errorf("invalid AES-CBC IV length %d", len(iv))
+	}
+
+	prf, err := pbkdf2PRF(kdfParams.PRF)
+	if err != nil {
+		return nil, err
+	}
+	key := pbkdf2.Key(password, kdfParams.Salt, kdfParams.IterationCount, 32, prf)
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AES cipher: %w", err)
+	}
+	if len(info.EncryptedData) == 0 || len(info.EncryptedData)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("encrypted data is not a multiple of the block size")
+	}
+	plaintext := make([]byte, len(info.EncryptedData))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, info.EncryptedData)
+
+	plaintext, err = pkcs7Unpad(plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt private key: incorrect password or corrupt data")
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse decrypted PKCS#8 private key: %w", err)
+	}
+	key2, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key is not an RSA key")
+	}
+	return key2, nil
+}
+
+// ImportKeyFromFile reads a PEM-encoded private key from filename and
+// returns the parsed key. If the PEM block is encrypted and password is
+// empty, it returns ErrPasswordRequired so the caller can prompt and retry.
+// It transparently handles PKCS#1 ("RSA PRIVATE KEY", including
+// legacy-encrypted blocks), unencrypted PKCS#8 ("PRIVATE KEY"), and
+// PBES2-encrypted PKCS#8 ("ENCRYPTED PRIVATE KEY") blocks, so keys produced
+// by e.g. `openssl pkcs8 -topk8` load just as well as the keys this package
+// generates.
+func ImportKeyFromFile(filename string, password []byte) (*rsa.PrivateKey, error) {
+	raw, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", filename, err)
+	}
+
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", filename)
+	}
+
+	if block.Type == "ENCRYPTED PRIVATE KEY" {
+		if len(password) == 0 {
+			return nil, ErrPasswordRequired
+		}
+		return decryptPKCS8PrivateKey(block.Bytes, password)
+	}
+
+	der := block.Bytes
+	if x509.IsEncryptedPEMBlock(block) {
+		if len(password) == 0 {
+			return nil, ErrPasswordRequired
+		}
+		der, err = x509.DecryptPEMBlock(block, password)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt private key: %w", err)
+		}
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key as PKCS#1 or PKCS#8: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key is not an RSA key")
+	}
+	return key, nil
+}